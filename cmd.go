@@ -2,11 +2,14 @@ package gosu
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mgutz/ansi"
 	"github.com/mgutz/gosu/util"
@@ -16,29 +19,64 @@ import (
 // In is used by Bash(), Run() and Start() to set the working directory
 type In []string
 
-var spawnedProcesses = make(map[string]*os.Process)
+// spawnedProcess tracks a process started by Start/StartContext so that a
+// later call with the same command can kill it before replacing it. done
+// is closed once the process has been reaped by its owning goroutine.
+type spawnedProcess struct {
+	process *os.Process
+	done    chan struct{}
+}
+
+// killGracePeriod is how long killSpawned waits for a SIGTERM'd process
+// group to exit before escalating to SIGKILL.
+const killGracePeriod = 5 * time.Second
+
+var (
+	spawnedMu        sync.Mutex
+	spawnedProcesses = make(map[string]*spawnedProcess)
+)
 
 // Bash executes a bash script (string) with an option to set
 // the working directory.
 func Bash(script string, wd ...In) error {
-	_, err := bash(false, script, wd)
+	_, err := bash(context.Background(), 0, false, script, wd)
 	return err
 }
 
 // BashOutput is the same as Bash and it captures stdout and stderr.
 func BashOutput(script string, wd ...In) (string, error) {
-	return bash(true, script, wd)
+	return bash(context.Background(), 0, true, script, wd)
+}
+
+// BashContext is the same as Bash except the script is run with
+// exec.CommandContext, so cancelling ctx (or hitting the deadline of a ctx
+// derived with context.WithDeadline/WithTimeout) kills the process. If
+// timeout is non-zero, it is applied in addition to ctx's own deadline,
+// whichever elapses first.
+func BashContext(ctx context.Context, timeout time.Duration, script string, wd ...In) error {
+	_, err := bash(ctx, timeout, false, script, wd)
+	return err
 }
 
 // Run runs a command with an an option to set the working directory.
 func Run(commandstr string, wd ...In) error {
-	_, err := run(false, commandstr, wd)
+	_, err := run(context.Background(), 0, false, commandstr, wd)
 	return err
 }
 
 // RunOutput is same as Run and it captures stdout and stderr.
 func RunOutput(commandstr string, wd ...In) (string, error) {
-	return run(true, commandstr, wd)
+	return run(context.Background(), 0, true, commandstr, wd)
+}
+
+// RunContext is the same as Run except it is run with exec.CommandContext,
+// so cancelling ctx (or hitting the deadline of a ctx derived with
+// context.WithDeadline/WithTimeout) kills the process. If timeout is
+// non-zero, it is applied in addition to ctx's own deadline, whichever
+// elapses first.
+func RunContext(ctx context.Context, timeout time.Duration, commandstr string, wd ...In) error {
+	_, err := run(ctx, timeout, false, commandstr, wd)
+	return err
 }
 
 // Start starts an async command. If executable has suffix ".go" then it will
@@ -48,6 +86,15 @@ func RunOutput(commandstr string, wd ...In) (string, error) {
 //
 // The working directory is optional.
 func Start(commandstr string, wd ...In) error {
+	return StartContext(context.Background(), 0, commandstr, wd...)
+}
+
+// StartContext is the same as Start except the spawned process is run with
+// exec.CommandContext, so cancelling ctx (or hitting the deadline of a ctx
+// derived with context.WithDeadline/WithTimeout) kills it. If timeout is
+// non-zero, it is applied in addition to ctx's own deadline, whichever
+// elapses first.
+func StartContext(ctx context.Context, timeout time.Duration, commandstr string, wd ...In) error {
 	dir, err := getWd(wd)
 	if err != nil {
 		return err
@@ -56,7 +103,7 @@ func Start(commandstr string, wd ...In) error {
 	executable, argv, env := splitCommand(commandstr)
 	isGoFile := strings.HasSuffix(executable, ".go")
 	if isGoFile {
-		err = Run("go install", wd...)
+		err = RunContext(ctx, timeout, "go install", wd...)
 		if err != nil {
 			return err
 		}
@@ -68,13 +115,85 @@ func Start(commandstr string, wd ...In) error {
 		wd:         dir,
 		env:        env,
 		argv:       argv,
+		ctx:        ctx,
+		timeout:    timeout,
 	}
 	return cmd.runAsync()
 }
 
+// BashSink is the same as BashContext, except the script's output is routed
+// through sink instead of the parent's stdout/stderr, and Started/Stdout/
+// Stderr/Exited events are emitted on sink.Events if set.
+func BashSink(ctx context.Context, sink *OutputSink, script string, wd ...In) error {
+	dir, err := getWd(wd)
+	if err != nil {
+		return err
+	}
+
+	gcmd := &command{
+		executable: "bash",
+		argv:       []string{"-c", script},
+		wd:         dir,
+		ctx:        ctx,
+		sink:       sink,
+	}
+	_, err = gcmd.run()
+	return err
+}
+
+// RunSink is the same as RunContext, except commandstr's output is routed
+// through sink instead of the parent's stdout/stderr, and Started/Stdout/
+// Stderr/Exited events are emitted on sink.Events if set.
+func RunSink(ctx context.Context, sink *OutputSink, commandstr string, wd ...In) error {
+	dir, err := getWd(wd)
+	if err != nil {
+		return err
+	}
+	executable, argv, env := splitCommand(commandstr)
+
+	gcmd := &command{
+		executable: executable,
+		wd:         dir,
+		env:        env,
+		argv:       argv,
+		ctx:        ctx,
+		sink:       sink,
+	}
+	_, err = gcmd.run()
+	return err
+}
+
+// StartSink is the same as StartContext, except the process's output is
+// routed through sink instead of the parent's stdout/stderr, and Started/
+// Stdout/Stderr/Exited events are emitted on sink.Events if set.
+func StartSink(ctx context.Context, sink *OutputSink, commandstr string, wd ...In) error {
+	dir, err := getWd(wd)
+	if err != nil {
+		return err
+	}
+
+	executable, argv, env := splitCommand(commandstr)
+	if strings.HasSuffix(executable, ".go") {
+		if err = RunContext(ctx, 0, "go install", wd...); err != nil {
+			return err
+		}
+		executable = path.Base(dir)
+	}
+
+	gcmd := &command{
+		executable: executable,
+		wd:         dir,
+		env:        env,
+		argv:       argv,
+		ctx:        ctx,
+		sink:       sink,
+	}
+	return gcmd.runAsync()
+}
+
 // Bash executes a bash string. Use backticks for multiline. To execute as shell script,
 // use Run("bash script.sh")
-func bash(captureOutput bool, script string, wd []In) (output string, err error) {
+func bash(ctx context.Context, timeout time.Duration, captureOutput bool, script string, wd []In) (output string, err error) {
 	dir, err := getWd(wd)
 	if err != nil {
 		return
@@ -85,6 +204,8 @@ func bash(captureOutput bool, script string, wd []In) (output string, err error)
 		argv:          []string{"-c", script},
 		wd:            dir,
 		captureOutput: captureOutput,
+		ctx:           ctx,
+		timeout:       timeout,
 	}
 
 	return gcmd.run()
@@ -97,7 +218,7 @@ func getWd(wd []In) (string, error) {
 	return os.Getwd()
 }
 
-func run(captureOutput bool, commandstr string, wd []In) (output string, err error) {
+func run(ctx context.Context, timeout time.Duration, captureOutput bool, commandstr string, wd []In) (output string, err error) {
 	dir, err := getWd(wd)
 	if err != nil {
 		return
@@ -110,6 +231,8 @@ func run(captureOutput bool, commandstr string, wd []In) (output string, err err
 		env:           env,
 		argv:          argv,
 		captureOutput: captureOutput,
+		ctx:           ctx,
+		timeout:       timeout,
 	}
 	return cmd.run()
 }
@@ -142,6 +265,9 @@ type command struct {
 	wd            string
 	captureOutput bool
 	recorder      bytes.Buffer
+	ctx           context.Context
+	timeout       time.Duration
+	sink          *OutputSink
 }
 
 func (gcmd *command) hash() string {
@@ -151,8 +277,24 @@ func (gcmd *command) hash() string {
 	return gcmd.executable
 }
 
-func (gcmd *command) toCmd() (cmd *exec.Cmd, err error) {
-	cmd = exec.Command(gcmd.executable, gcmd.argv...)
+// context returns the context to run gcmd under, applying gcmd.timeout on
+// top of gcmd.ctx (or context.Background() if none was set). The returned
+// cancel func must always be called to release resources.
+func (gcmd *command) context() (context.Context, context.CancelFunc) {
+	ctx := gcmd.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if gcmd.timeout > 0 {
+		return context.WithTimeout(ctx, gcmd.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (gcmd *command) toCmd(ctx context.Context) (cmd *exec.Cmd, err error) {
+	cmd = exec.CommandContext(ctx, gcmd.executable, gcmd.argv...)
+	setProcGroup(cmd)
+	armGroupCancel(cmd)
 	if gcmd.wd != "" {
 		cmd.Dir = gcmd.wd
 	}
@@ -160,6 +302,12 @@ func (gcmd *command) toCmd() (cmd *exec.Cmd, err error) {
 	cmd.Env = effectiveEnv(gcmd.env)
 	cmd.Stdin = os.Stdin
 
+	if gcmd.sink != nil {
+		cmd.Stdout = gcmd.sink.stdoutWriter(gcmd)
+		cmd.Stderr = gcmd.sink.stderrWriter(gcmd)
+		return cmd, nil
+	}
+
 	if gcmd.captureOutput {
 		outWrapper := newFileWrapper(os.Stdout, &gcmd.recorder, "")
 		errWrapper := newFileWrapper(os.Stderr, &gcmd.recorder, ansi.ColorCode("red+b"))
@@ -173,41 +321,78 @@ func (gcmd *command) toCmd() (cmd *exec.Cmd, err error) {
 }
 
 func (gcmd *command) run() (output string, err error) {
+	ctx, cancel := gcmd.context()
+	defer cancel()
 
-	cmd, err := gcmd.toCmd()
+	cmd, err := gcmd.toCmd(ctx)
 	if err != nil {
 		return
 	}
 
-	err = cmd.Run()
+	if err = cmd.Start(); err != nil {
+		gcmd.sink.emit(Exited{Code: -1, Err: err})
+		return "", translateCtxErr(ctx, err)
+	}
+	gcmd.sink.emit(Started{PID: cmd.Process.Pid})
+
+	waitErr := cmd.Wait()
+	err = translateCtxErr(ctx, waitErr)
+	gcmd.sink.emit(Exited{Code: exitCode(waitErr), Err: err})
+
 	if gcmd.captureOutput {
 		return gcmd.recorder.String(), err
 	}
 	return "", err
 }
 
+// translateCtxErr surfaces context.DeadlineExceeded/context.Canceled instead
+// of the generic "signal: killed" *exec.ExitError that exec.CommandContext
+// produces once it kills the process for an expired/cancelled ctx.
+func translateCtxErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 func (gcmd *command) runAsync() (err error) {
-	cmd, err := gcmd.toCmd()
+	ctx, cancel := gcmd.context()
+
+	cmd, err := gcmd.toCmd(ctx)
 	if err != nil {
+		cancel()
 		return
 	}
 
 	id := gcmd.hash()
 
-	// kills previously spawned process (if exists)
+	// kills previously spawned process (and its whole process group) if
+	// one exists
 	killSpawned(id)
+
+	if err = cmd.Start(); err != nil {
+		cancel()
+		gcmd.sink.emit(Exited{Code: -1, Err: err})
+		return
+	}
+	gcmd.sink.emit(Started{PID: cmd.Process.Pid})
+
+	// Register the process before the wait goroutine is launched, so a
+	// killSpawned for the same id can never race ahead of this entry
+	// existing in the map.
+	done := make(chan struct{})
+	spawnedMu.Lock()
+	spawnedProcesses[id] = &spawnedProcess{process: cmd.Process, done: done}
+	spawnedMu.Unlock()
+
 	waitExit = true
 	waitgroup.Add(1)
 	go func() {
-		err = cmd.Start()
-		if err != nil {
-			return
-		}
-		spawnedProcesses[id] = cmd.Process
-		c := make(chan error, 1)
-		c <- cmd.Wait()
-		_ = <-c
-		waitgroup.Done()
+		defer cancel()
+		defer close(done)
+		defer waitgroup.Done()
+		waitErr := cmd.Wait()
+		gcmd.sink.emit(Exited{Code: exitCode(waitErr), Err: translateCtxErr(ctx, waitErr)})
 	}()
 	return nil
 }
@@ -220,15 +405,19 @@ func toInt(s string) int {
 	return result
 }
 
-func killSpawned(command string) {
-	process := spawnedProcesses[command]
-	if process == nil {
+func killSpawned(id string) {
+	spawnedMu.Lock()
+	sp := spawnedProcesses[id]
+	delete(spawnedProcesses, id)
+	spawnedMu.Unlock()
+
+	if sp == nil {
 		return
 	}
 
-	err := process.Kill()
+	err := killProcessGroup(sp.process, sp.done, killGracePeriod)
 	if err != nil {
-		util.Error("Start", "Could not kill existing process %+v\n", process)
+		util.Error("Start", "Could not kill existing process %+v\n", sp.process)
 		return
 	}
 }
@@ -0,0 +1,106 @@
+package gosu
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Invocation is a structured description of a single external command,
+// mirroring the Invocation type in golang.org/x/tools/internal/gocommand.
+// Unlike the string-based Run/Bash helpers (which parse arguments with
+// str.ToArgv via splitCommand), Invocation takes Args as a slice, so
+// arguments containing spaces or quotes need no escaping, and callers can
+// redirect stdout/stderr to arbitrary writers or inspect them separately.
+type Invocation struct {
+	// Executable is the program to run, e.g. "go".
+	Executable string
+	// Args are passed to Executable, not including Executable itself.
+	Args []string
+	// Env holds "key=value" pairs for the child process. By default
+	// (ReplaceEnv false) these are appended to the current process's
+	// environment; with ReplaceEnv true, Env is the entire environment.
+	Env []string
+	// ReplaceEnv, if true, makes Env the child's entire environment
+	// instead of appending it to the parent's.
+	ReplaceEnv bool
+	// Dir is the working directory. Empty means the current directory.
+	Dir string
+	// Stdin, if set, is connected to the child's stdin. Defaults to the
+	// parent's stdin.
+	Stdin io.Reader
+	// Stdout and Stderr, if set, receive the child's output in addition
+	// to anything CaptureOutput records. Default to the parent's stdout
+	// and stderr.
+	Stdout, Stderr io.Writer
+	// CaptureOutput records stdout and stderr so RunRaw can return them
+	// as separate *bytes.Buffer values.
+	CaptureOutput bool
+	// Timeout, if non-zero, bounds how long the invocation may run
+	// before it is killed and context.DeadlineExceeded is returned.
+	Timeout time.Duration
+}
+
+// Run runs the invocation and returns a single friendly error, discarding
+// any captured output. It is a convenience wrapper around RunRaw for
+// callers that don't need stdout and stderr separately.
+func (iv *Invocation) Run(ctx context.Context) error {
+	_, _, friendlyErr, _ := iv.RunRaw(ctx)
+	return friendlyErr
+}
+
+// RunRaw runs the invocation and returns its captured stdout/stderr (nil
+// unless CaptureOutput is set), a friendlyErr with context.DeadlineExceeded
+// / context.Canceled surfaced distinctly from *exec.ExitError, and rawErr,
+// the unwrapped error returned by (*exec.Cmd).Run.
+func (iv *Invocation) RunRaw(ctx context.Context) (stdout, stderr *bytes.Buffer, friendlyErr, rawErr error) {
+	if iv.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, iv.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, iv.Executable, iv.Args...)
+	setProcGroup(cmd)
+	armGroupCancel(cmd)
+	if iv.Dir != "" {
+		cmd.Dir = iv.Dir
+	}
+
+	if iv.ReplaceEnv {
+		// A nil cmd.Env would inherit the parent's environment.
+		cmd.Env = append([]string{}, iv.Env...)
+	} else {
+		cmd.Env = effectiveEnv(iv.Env)
+	}
+
+	cmd.Stdin = iv.Stdin
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+
+	outPassthrough, errPassthrough := iv.Stdout, iv.Stderr
+	if outPassthrough == nil {
+		outPassthrough = os.Stdout
+	}
+	if errPassthrough == nil {
+		errPassthrough = os.Stderr
+	}
+
+	if iv.CaptureOutput {
+		stdout = &bytes.Buffer{}
+		stderr = &bytes.Buffer{}
+		cmd.Stdout = io.MultiWriter(outPassthrough, stdout)
+		cmd.Stderr = io.MultiWriter(errPassthrough, stderr)
+	} else {
+		cmd.Stdout = outPassthrough
+		cmd.Stderr = errPassthrough
+	}
+
+	rawErr = cmd.Run()
+	friendlyErr = translateCtxErr(ctx, rawErr)
+	return stdout, stderr, friendlyErr, rawErr
+}
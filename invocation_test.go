@@ -0,0 +1,128 @@
+package gosu
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestInvocationReplaceEnvAppendsByDefault covers the ReplaceEnv zero value:
+// Env entries are appended to the parent's environment rather than
+// replacing it, so GOSU_TEST_CHILD_VAR must show up alongside the inherited
+// GOSU_TEST_PARENT_VAR.
+func TestInvocationReplaceEnvAppendsByDefault(t *testing.T) {
+	os.Setenv("GOSU_TEST_PARENT_VAR", "from-parent")
+	defer os.Unsetenv("GOSU_TEST_PARENT_VAR")
+
+	iv := &Invocation{
+		Executable:    "env",
+		Env:           []string{"GOSU_TEST_CHILD_VAR=from-child"},
+		CaptureOutput: true,
+	}
+	stdout, _, friendlyErr, rawErr := iv.RunRaw(context.Background())
+	if rawErr != nil {
+		t.Fatalf("RunRaw() rawErr = %v", rawErr)
+	}
+	if friendlyErr != nil {
+		t.Fatalf("RunRaw() friendlyErr = %v", friendlyErr)
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "GOSU_TEST_PARENT_VAR=from-parent") {
+		t.Errorf("child env missing inherited GOSU_TEST_PARENT_VAR; env:\n%s", out)
+	}
+	if !strings.Contains(out, "GOSU_TEST_CHILD_VAR=from-child") {
+		t.Errorf("child env missing GOSU_TEST_CHILD_VAR; env:\n%s", out)
+	}
+}
+
+// TestInvocationReplaceEnvTrueReplacesEnv covers ReplaceEnv: true, which
+// must make Env the child's entire environment instead of appending to the
+// parent's.
+func TestInvocationReplaceEnvTrueReplacesEnv(t *testing.T) {
+	os.Setenv("GOSU_TEST_PARENT_VAR", "from-parent")
+	defer os.Unsetenv("GOSU_TEST_PARENT_VAR")
+
+	iv := &Invocation{
+		Executable:    "env",
+		Env:           []string{"GOSU_TEST_CHILD_VAR=from-child"},
+		ReplaceEnv:    true,
+		CaptureOutput: true,
+	}
+	stdout, _, friendlyErr, rawErr := iv.RunRaw(context.Background())
+	if rawErr != nil {
+		t.Fatalf("RunRaw() rawErr = %v", rawErr)
+	}
+	if friendlyErr != nil {
+		t.Fatalf("RunRaw() friendlyErr = %v", friendlyErr)
+	}
+
+	out := stdout.String()
+	if strings.Contains(out, "GOSU_TEST_PARENT_VAR") {
+		t.Errorf("child env leaked the parent's GOSU_TEST_PARENT_VAR with ReplaceEnv true; env:\n%s", out)
+	}
+	if strings.TrimSpace(out) != "GOSU_TEST_CHILD_VAR=from-child" {
+		t.Errorf("child env = %q, want only GOSU_TEST_CHILD_VAR=from-child", out)
+	}
+}
+
+// TestInvocationCaptureOutputTeesAndCaptures covers CaptureOutput: the
+// child's stdout/stderr must both be captured into the returned buffers and
+// still be teed to the configured passthrough writers.
+func TestInvocationCaptureOutputTeesAndCaptures(t *testing.T) {
+	var passthroughOut, passthroughErr bytes.Buffer
+	iv := &Invocation{
+		Executable:    "bash",
+		Args:          []string{"-c", "echo out-line; echo err-line 1>&2"},
+		Stdout:        &passthroughOut,
+		Stderr:        &passthroughErr,
+		CaptureOutput: true,
+	}
+	stdout, stderr, friendlyErr, rawErr := iv.RunRaw(context.Background())
+	if rawErr != nil {
+		t.Fatalf("RunRaw() rawErr = %v", rawErr)
+	}
+	if friendlyErr != nil {
+		t.Fatalf("RunRaw() friendlyErr = %v", friendlyErr)
+	}
+
+	if got := stdout.String(); got != "out-line\n" {
+		t.Errorf("captured stdout = %q, want %q", got, "out-line\n")
+	}
+	if got := stderr.String(); got != "err-line\n" {
+		t.Errorf("captured stderr = %q, want %q", got, "err-line\n")
+	}
+	if got := passthroughOut.String(); got != "out-line\n" {
+		t.Errorf("passthrough stdout = %q, want %q", got, "out-line\n")
+	}
+	if got := passthroughErr.String(); got != "err-line\n" {
+		t.Errorf("passthrough stderr = %q, want %q", got, "err-line\n")
+	}
+}
+
+// TestInvocationNoCaptureOutputReturnsNilBuffers covers the default
+// (CaptureOutput false) case: RunRaw must not allocate capture buffers.
+func TestInvocationNoCaptureOutputReturnsNilBuffers(t *testing.T) {
+	var passthroughOut bytes.Buffer
+	iv := &Invocation{
+		Executable: "bash",
+		Args:       []string{"-c", "echo out-line"},
+		Stdout:     &passthroughOut,
+		Stderr:     &bytes.Buffer{},
+	}
+	stdout, stderr, friendlyErr, rawErr := iv.RunRaw(context.Background())
+	if rawErr != nil {
+		t.Fatalf("RunRaw() rawErr = %v", rawErr)
+	}
+	if friendlyErr != nil {
+		t.Fatalf("RunRaw() friendlyErr = %v", friendlyErr)
+	}
+	if stdout != nil || stderr != nil {
+		t.Errorf("RunRaw() stdout/stderr = %v/%v, want nil/nil without CaptureOutput", stdout, stderr)
+	}
+	if got := passthroughOut.String(); got != "out-line\n" {
+		t.Errorf("passthrough stdout = %q, want %q", got, "out-line\n")
+	}
+}
@@ -0,0 +1,155 @@
+package gosu
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// defaultWriter returns the parent's stdout or stderr for the given
+// stream name, used when an OutputSink leaves that stream unset.
+func defaultWriter(stream string) io.Writer {
+	if stream == "stdout" {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// Event is emitted on an OutputSink's Events channel while a command
+// runs, so gosu tasks can be composed programmatically (piping one task's
+// stdout into another's stdin, tee-ing to log files, or aggregating
+// output from many parallel Runner workers) instead of only dumping to
+// the parent's terminal.
+type Event interface {
+	isEvent()
+}
+
+// Started is emitted once the child process has been spawned.
+type Started struct {
+	PID int
+}
+
+// Stdout is emitted for each line the child writes to stdout.
+type Stdout struct {
+	Line string
+}
+
+// Stderr is emitted for each line the child writes to stderr.
+type Stderr struct {
+	Line string
+}
+
+// Exited is emitted once the child has exited.
+type Exited struct {
+	Code int
+	Err  error
+}
+
+func (Started) isEvent() {}
+func (Stdout) isEvent()  {}
+func (Stderr) isEvent()  {}
+func (Exited) isEvent()  {}
+
+// OutputSink replaces a command's hardcoded os.Stdout/os.Stderr wiring
+// with configurable destinations, an optional per-line callback, and an
+// optional structured event stream.
+type OutputSink struct {
+	// Stdout and Stderr receive the child's raw output. Nil defaults to
+	// os.Stdout/os.Stderr respectively.
+	Stdout, Stderr io.Writer
+	// Prefix, if set, is prepended (as "Prefix| ") to every line written
+	// to Stdout/Stderr, useful for telling apart many parallel Runner
+	// workers' output in a shared terminal or log file.
+	Prefix string
+	// OnLine, if set, is called for every complete line the child
+	// writes, tagged with stream "stdout" or "stderr".
+	OnLine func(stream, line string)
+	// Events, if set, receives this command's Started/Stdout/Stderr/
+	// Exited events. The caller owns and should drain it; sends block,
+	// so an unbuffered Events channel must have a concurrent reader.
+	Events chan<- Event
+}
+
+func (sink *OutputSink) emit(e Event) {
+	if sink == nil || sink.Events == nil {
+		return
+	}
+	sink.Events <- e
+}
+
+func (sink *OutputSink) stdoutWriter(gcmd *command) io.Writer {
+	return sink.streamWriter(gcmd, "stdout", sink.Stdout)
+}
+
+func (sink *OutputSink) stderrWriter(gcmd *command) io.Writer {
+	return sink.streamWriter(gcmd, "stderr", sink.Stderr)
+}
+
+func (sink *OutputSink) streamWriter(gcmd *command, stream string, dest io.Writer) io.Writer {
+	if dest == nil {
+		dest = defaultWriter(stream)
+	}
+	if gcmd.captureOutput {
+		dest = io.MultiWriter(dest, &gcmd.recorder)
+	}
+	return &lineWriter{
+		out:    dest,
+		prefix: sink.Prefix,
+		onLine: func(line string) {
+			if sink.OnLine != nil {
+				sink.OnLine(stream, line)
+			}
+			if stream == "stdout" {
+				sink.emit(Stdout{Line: line})
+			} else {
+				sink.emit(Stderr{Line: line})
+			}
+		},
+	}
+}
+
+// lineWriter splits whatever is written to it into lines, forwarding each
+// complete line (with an optional prefix) to out and invoking onLine with
+// the unprefixed line.
+type lineWriter struct {
+	out    io.Writer
+	prefix string
+	onLine func(line string)
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// incomplete line; put it back and wait for more
+			w.buf.WriteString(line)
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+		w.onLine(line)
+		if w.prefix != "" {
+			line = w.prefix + "| " + line
+		}
+		if _, err := w.out.Write([]byte(line + "\n")); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// exitCode extracts the child's exit code from the error returned by
+// (*exec.Cmd).Wait, or -1 if it can't be determined (e.g. the process
+// never started).
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,87 @@
+package gosu
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestLineWriterSplitsAndPrefixesLines(t *testing.T) {
+	var out bytes.Buffer
+	var lines []string
+	w := &lineWriter{
+		out:    &out,
+		prefix: "worker",
+		onLine: func(line string) { lines = append(lines, line) },
+	}
+
+	if _, err := w.Write([]byte("first\nsecond")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := w.Write([]byte(" line\nthird\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	wantLines := []string{"first", "second line", "third"}
+	if len(lines) != len(wantLines) {
+		t.Fatalf("onLine saw %v, want %v", lines, wantLines)
+	}
+	for i, want := range wantLines {
+		if lines[i] != want {
+			t.Errorf("lines[%d] = %q, want %q", i, lines[i], want)
+		}
+	}
+
+	wantOut := "worker| first\nworker| second line\nworker| third\n"
+	if got := out.String(); got != wantOut {
+		t.Errorf("out = %q, want %q", got, wantOut)
+	}
+}
+
+func TestLineWriterBuffersIncompleteLine(t *testing.T) {
+	var out bytes.Buffer
+	w := &lineWriter{out: &out, onLine: func(string) {}}
+
+	if _, err := w.Write([]byte("no newline yet")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := out.String(); got != "" {
+		t.Errorf("out = %q before a newline arrives, want empty", got)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if got := exitCode(nil); got != 0 {
+		t.Errorf("exitCode(nil) = %d, want 0", got)
+	}
+	if got := exitCode(errors.New("boom")); got != -1 {
+		t.Errorf("exitCode(generic error) = %d, want -1", got)
+	}
+}
+
+// TestExitCodeFromExitError re-execs the test binary as a helper process
+// that exits with a known status, the standard os/exec testing pattern for
+// getting a real *exec.ExitError without depending on an external binary.
+func TestExitCodeFromExitError(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcessExitsWithCode3")
+	cmd.Env = append(os.Environ(), "GOSU_WANT_HELPER_PROCESS=1")
+
+	err := cmd.Run()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("cmd.Run() error = %T(%v), want *exec.ExitError", err, err)
+	}
+
+	if got := exitCode(exitErr); got != 3 {
+		t.Errorf("exitCode(exitErr) = %d, want 3", got)
+	}
+}
+
+func TestHelperProcessExitsWithCode3(t *testing.T) {
+	if os.Getenv("GOSU_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	os.Exit(3)
+}
@@ -0,0 +1,121 @@
+//go:build !windows
+// +build !windows
+
+package gosu
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// isProcessAlive reports whether pid still refers to a live process, using
+// the POSIX convention of probing with signal 0.
+func isProcessAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+// waitForFileContents polls path until it is non-empty or timeout elapses,
+// failing the test if it never appears.
+func waitForFileContents(t *testing.T, path string, timeout time.Duration) string {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(path)
+		if err == nil && len(data) > 0 {
+			return string(data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s never received contents within %s", path, timeout)
+	return ""
+}
+
+// waitForProcessDeath polls pid until it is gone or timeout elapses, failing
+// the test if it is still alive afterwards.
+func waitForProcessDeath(t *testing.T, pid int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !isProcessAlive(pid) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("pid %d is still alive after %s", pid, timeout)
+}
+
+// TestBashContextCancelKillsWholeProcessGroup guards against armGroupCancel
+// regressing to the default cmd.Cancel, which only kills the direct child:
+// the script here backgrounds a grandchild (sleep) and waits on it, so if
+// cancellation only reached "bash" the grandchild would be orphaned and keep
+// running.
+func TestBashContextCancelKillsWholeProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "grandchild.pid")
+	script := fmt.Sprintf("sleep 30 & echo $! > %s; wait", pidFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- BashContext(ctx, 0, script)
+	}()
+
+	pid := toInt(strings.TrimSpace(waitForFileContents(t, pidFile, 2*time.Second)))
+	if pid == 0 {
+		t.Fatalf("could not parse grandchild pid from %s", pidFile)
+	}
+	if !isProcessAlive(pid) {
+		t.Fatalf("grandchild pid %d exited before cancellation", pid)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("BashContext did not return after cancel")
+	}
+
+	waitForProcessDeath(t, pid, 2*time.Second)
+}
+
+// TestStartKillsPreviousProcessGroupIncludingGrandchildren guards
+// killSpawned/killProcessGroup: starting the same command twice must tear
+// down the first run's whole process group, not just its direct child,
+// before launching the replacement.
+func TestStartKillsPreviousProcessGroupIncludingGrandchildren(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "grandchild.pid")
+	newCmd := func() *command {
+		return &command{
+			executable: "bash",
+			argv:       []string{"-c", fmt.Sprintf("sleep 30 & echo $! > %s; wait", pidFile)},
+			ctx:        context.Background(),
+		}
+	}
+
+	if err := newCmd().runAsync(); err != nil {
+		t.Fatalf("first runAsync() error = %v", err)
+	}
+
+	pid := toInt(strings.TrimSpace(waitForFileContents(t, pidFile, 2*time.Second)))
+	if pid == 0 {
+		t.Fatalf("could not parse grandchild pid from %s", pidFile)
+	}
+	if !isProcessAlive(pid) {
+		t.Fatalf("grandchild pid %d exited before the restart", pid)
+	}
+
+	// Starting the identical command again hashes to the same id, so
+	// runAsync's killSpawned call should reap the first run's whole group
+	// -- including its grandchild -- before launching the second.
+	if err := newCmd().runAsync(); err != nil {
+		t.Fatalf("second runAsync() error = %v", err)
+	}
+	t.Cleanup(func() { killSpawned(newCmd().hash()) })
+
+	waitForProcessDeath(t, pid, 2*time.Second)
+}
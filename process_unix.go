@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package gosu
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcGroup configures cmd to run in its own process group so that
+// cancellation can terminate the whole subtree rather than just the
+// immediate child.
+func setProcGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// armGroupCancel overrides cmd.Cancel so that, when the context behind an
+// exec.CommandContext is cancelled or times out, the whole process group
+// started by setProcGroup is signalled rather than just the direct child
+// (the default cmd.Cancel only calls cmd.Process.Kill()). cmd.WaitDelay
+// bounds how long Wait gives the group to exit before exec force-closes
+// its I/O pipes.
+func armGroupCancel(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		time.AfterFunc(killGracePeriod, func() {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		})
+		return nil
+	}
+	cmd.WaitDelay = killGracePeriod
+}
+
+// killProcessGroup signals process's whole process group (its pgid equals
+// its pid, since it was started with Setpgid) with SIGTERM, then escalates
+// to SIGKILL if it hasn't exited by the time grace elapses. done is closed
+// once the process has actually been reaped; it is not touched here.
+func killProcessGroup(process *os.Process, done <-chan struct{}, grace time.Duration) error {
+	pgid := process.Pid
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		if err == syscall.ESRCH {
+			return nil
+		}
+		return err
+	}
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package gosu
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcGroup configures cmd to run in its own process group so that
+// cancellation can terminate the whole subtree rather than just the
+// immediate child.
+func setProcGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags = syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// killProcessGroup terminates process directly. Windows has no POSIX-style
+// signal to broadcast to a process group; CREATE_NEW_PROCESS_GROUP mainly
+// exists so the group can be targeted with CTRL_BREAK_EVENT, which console
+// processes can choose to ignore, so we go straight for termination. done
+// and grace are accepted for symmetry with the Unix implementation but are
+// unused here.
+func killProcessGroup(process *os.Process, done <-chan struct{}, grace time.Duration) error {
+	return process.Kill()
+}
+
+// armGroupCancel leaves cmd.Cancel at its default (cmd.Process.Kill()).
+// Windows has no -pgid signal broadcast; CREATE_NEW_PROCESS_GROUP mainly
+// exists so the group can be targeted with CTRL_BREAK_EVENT, which console
+// processes can choose to ignore, so killing the group leader directly is
+// the best we can do here. cmd.WaitDelay is still set for symmetry with
+// the Unix implementation.
+func armGroupCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = killGracePeriod
+}
@@ -0,0 +1,234 @@
+package gosu
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ReadyFunc inspects a line written to the child's stdout and reports
+// whether it signals that the process is ready to serve traffic. It is the
+// fallback readiness mechanism for programs that don't speak the
+// sd_notify protocol.
+type ReadyFunc func(stdoutLine string) bool
+
+// StartReadyOption configures StartReady.
+type StartReadyOption func(*startReadyConfig)
+
+type startReadyConfig struct {
+	ctx       context.Context
+	timeout   time.Duration
+	dir       string
+	readyFunc ReadyFunc
+}
+
+// WithReadyContext sets the context used to cancel StartReady while it is
+// waiting for readiness. Defaults to context.Background().
+func WithReadyContext(ctx context.Context) StartReadyOption {
+	return func(c *startReadyConfig) { c.ctx = ctx }
+}
+
+// WithReadyTimeout bounds how long StartReady will wait for the child to
+// signal readiness before giving up. If it elapses first, the child is
+// killed and context.DeadlineExceeded is returned.
+func WithReadyTimeout(timeout time.Duration) StartReadyOption {
+	return func(c *startReadyConfig) { c.timeout = timeout }
+}
+
+// WithReadyDir sets the working directory, mirroring the wd argument of
+// Start/Run/Bash. Defaults to the current directory.
+func WithReadyDir(dir string) StartReadyOption {
+	return func(c *startReadyConfig) { c.dir = dir }
+}
+
+// WithReadyFunc supplies a fallback readiness detector that scans the
+// child's stdout, for processes that don't notify via NOTIFY_SOCKET.
+func WithReadyFunc(fn ReadyFunc) StartReadyOption {
+	return func(c *startReadyConfig) { c.readyFunc = fn }
+}
+
+// StartReady is the same as Start, except it blocks until the child
+// signals that it is ready rather than returning as soon as it is spawned.
+// Readiness is detected either of two ways:
+//
+//   - sd_notify: gosu creates a NOTIFY_SOCKET unix datagram socket, passes
+//     its address to the child via the environment, and waits for a
+//     "READY=1" datagram, the same protocol systemd services use.
+//   - WithReadyFunc: a caller-supplied function that scans the child's
+//     stdout for a readiness marker, for programs that don't speak
+//     sd_notify.
+//
+// If the child exits before signaling readiness, its *exec.ExitError (or
+// the error from starting it) is returned.
+func StartReady(commandstr string, opts ...StartReadyOption) error {
+	cfg := &startReadyConfig{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	ctx := cfg.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// The timeout bounds only the wait for readiness: the child runs under
+	// ctx, so once ready it keeps running after StartReady returns.
+	waitCtx := ctx
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	dir := cfg.dir
+	if dir == "" {
+		var err error
+		dir, err = os.Getwd()
+		if err != nil {
+			return err
+		}
+	}
+
+	executable, argv, env := splitCommand(commandstr)
+	if strings.HasSuffix(executable, ".go") {
+		if err := RunContext(waitCtx, 0, "go install", In{dir}); err != nil {
+			return err
+		}
+		executable = path.Base(dir)
+	}
+
+	notifyAddr, notifyConn, notifyCleanup, err := newNotifySocket()
+	if err != nil {
+		return err
+	}
+	defer notifyCleanup()
+	if notifyAddr != "" {
+		env = append(env, "NOTIFY_SOCKET="+notifyAddr)
+	}
+
+	gcmd := &command{
+		executable: executable,
+		wd:         dir,
+		env:        env,
+		argv:       argv,
+		ctx:        ctx,
+	}
+
+	execCmd, err := gcmd.toCmd(ctx)
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan struct{}, 1)
+	if cfg.readyFunc != nil {
+		// Tap stdout with a lineWriter instead of an io.Pipe: the pipe's
+		// writer side would have to be closed once readiness is detected
+		// (or on return), and closing it while the child keeps writing
+		// poisons the MultiWriter and silently kills all of the child's
+		// stdout forwarding for the rest of its life. lineWriter keeps
+		// forwarding to os.Stdout for as long as the child runs.
+		execCmd.Stdout = &lineWriter{
+			out: os.Stdout,
+			onLine: func(line string) {
+				if cfg.readyFunc(line) {
+					select {
+					case ready <- struct{}{}:
+					default:
+					}
+				}
+			},
+		}
+	}
+
+	id := gcmd.hash()
+	killSpawned(id)
+
+	if err := execCmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	spawnedMu.Lock()
+	spawnedProcesses[id] = &spawnedProcess{process: execCmd.Process, done: done}
+	spawnedMu.Unlock()
+
+	exited := make(chan error, 1)
+	waitExit = true
+	waitgroup.Add(1)
+	go func() {
+		defer close(done)
+		defer waitgroup.Done()
+		exited <- execCmd.Wait()
+	}()
+
+	if notifyConn != nil {
+		go watchNotifySocket(notifyConn, ready)
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case err := <-exited:
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("gosu: %s exited before signaling readiness", commandstr)
+	case <-waitCtx.Done():
+		killSpawned(id)
+		return waitCtx.Err()
+	}
+}
+
+// notifySocketSeq makes each newNotifySocket's path unique even across
+// concurrent StartReady calls in the same process (e.g. orchestrating
+// several services in parallel), which would otherwise all collide on a
+// path derived from os.Getpid() alone.
+var notifySocketSeq int64
+
+// newNotifySocket creates a unix datagram socket for the sd_notify
+// protocol and returns the address to pass to the child via NOTIFY_SOCKET.
+// If creating the socket fails (e.g. unixgram isn't supported on this
+// platform), it returns a zero addr/conn and a nil error so StartReady
+// falls back to WithReadyFunc alone.
+func newNotifySocket() (addr string, conn *net.UnixConn, cleanup func(), err error) {
+	seq := atomic.AddInt64(&notifySocketSeq, 1)
+	sockPath := filepath.Join(os.TempDir(), fmt.Sprintf("gosu-notify-%d-%d.sock", os.Getpid(), seq))
+	os.Remove(sockPath)
+
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sockPath, Net: "unixgram"})
+	if err != nil {
+		return "", nil, func() {}, nil
+	}
+
+	cleanup = func() {
+		pc.Close()
+		os.Remove(sockPath)
+	}
+	return sockPath, pc, cleanup, nil
+}
+
+// watchNotifySocket reads datagrams from conn until it sees "READY=1" on a
+// line of its own, as sent by a child calling sd_notify(0, "READY=1").
+func watchNotifySocket(conn *net.UnixConn, ready chan<- struct{}) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "READY=1" {
+				select {
+				case ready <- struct{}{}:
+				default:
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package gosu
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStartReadyWithReadyFuncDetectsReadinessAndForwardsPostReadyOutput is a
+// regression test for the stdout-tap-close bug: StartReady must both detect
+// readiness via WithReadyFunc AND keep forwarding the child's stdout to
+// os.Stdout for as long as it keeps running afterwards.
+func TestStartReadyWithReadyFuncDetectsReadinessAndForwardsPostReadyOutput(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "ready.sh")
+	script := "#!/bin/sh\necho before-ready\nsleep 0.1\necho READY-MARKER\nsleep 0.2\necho AFTER-READY\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	origStdout := os.Stdout
+	os.Stdout = w
+
+	var mu sync.Mutex
+	var captured bytes.Buffer
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, 4096)
+		for {
+			n, readErr := r.Read(buf)
+			if n > 0 {
+				mu.Lock()
+				captured.Write(buf[:n])
+				mu.Unlock()
+			}
+			if readErr != nil {
+				return
+			}
+		}
+	}()
+
+	readyErr := StartReady("bash "+scriptPath, WithReadyFunc(func(line string) bool {
+		return line == "READY-MARKER"
+	}))
+	os.Stdout = origStdout
+	defer killSpawned((&command{executable: "bash", argv: []string{scriptPath}}).hash())
+
+	if readyErr != nil {
+		w.Close()
+		t.Fatalf("StartReady() error = %v", readyErr)
+	}
+
+	// Give the still-running child's AFTER-READY line time to land before
+	// closing the pipe -- closing it early would silently stop forwarding,
+	// which is exactly the bug this test guards against.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		out := captured.String()
+		mu.Unlock()
+		if strings.Contains(out, "AFTER-READY") || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	w.Close()
+	r.Close()
+	<-readDone
+
+	mu.Lock()
+	out := captured.String()
+	mu.Unlock()
+
+	if !strings.Contains(out, "before-ready") {
+		t.Errorf("captured stdout missing the pre-ready line:\n%s", out)
+	}
+	if !strings.Contains(out, "AFTER-READY") {
+		t.Errorf("captured stdout missing the line written after readiness was detected (stdout-tap-close regression):\n%s", out)
+	}
+}
+
+// TestStartReadySdNotify covers the sd_notify readiness mechanism: a child
+// that dials NOTIFY_SOCKET and sends "READY=1" should make StartReady return
+// promptly, without needing WithReadyFunc at all.
+func TestStartReadySdNotify(t *testing.T) {
+	commandstr := fmt.Sprintf("GOSU_WANT_HELPER_PROCESS=1 %s -test.run=TestHelperProcessNotifyReady", os.Args[0])
+
+	start := time.Now()
+	err := StartReady(commandstr, WithReadyTimeout(5*time.Second))
+	defer killSpawned((&command{executable: os.Args[0], argv: []string{"-test.run=TestHelperProcessNotifyReady"}}).hash())
+
+	if err != nil {
+		t.Fatalf("StartReady() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("StartReady() took %s to observe READY=1, want well under its 2s helper sleep", elapsed)
+	}
+}
+
+// TestHelperProcessNotifyReady is not a real test; it's re-exec'd as a child
+// process by TestStartReadySdNotify (the standard os/exec helper-process
+// pattern, see TestHelperProcessExitsWithCode3 in output_test.go) to speak
+// the sd_notify protocol against the NOTIFY_SOCKET StartReady hands it.
+func TestHelperProcessNotifyReady(t *testing.T) {
+	if os.Getenv("GOSU_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		os.Exit(1)
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		os.Exit(1)
+	}
+	conn.Write([]byte("READY=1"))
+	conn.Close()
+	time.Sleep(2 * time.Second)
+}
@@ -0,0 +1,97 @@
+package gosu
+
+import (
+	"context"
+	"regexp"
+)
+
+// goModRaceError matches the error go emits when two concurrent `go`
+// invocations race on the same module's go.mod, e.g.
+// "go: go.mod contents have changed" or
+// "go: main module's go.mod contents have changed".
+var goModRaceError = regexp.MustCompile(`(?i)go:.*go\.mod.*contents have changed`)
+
+// Runner limits how many external processes may execute at the same time,
+// modeled after the Runner/inFlight pattern in
+// golang.org/x/tools/internal/gocommand. Invocations that fail with a known
+// go toolchain concurrency error are automatically retried one at a time,
+// on a single-slot serial channel. The retry does not wait for other
+// in-flight invocations to finish; only retries are serialized.
+type Runner struct {
+	inFlight chan bool
+	serial   chan bool
+}
+
+// NewRunner returns a Runner that allows at most maxInFlight processes to
+// run concurrently. maxInFlight <= 0 is treated as 1.
+func NewRunner(maxInFlight int) *Runner {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	return &Runner{
+		inFlight: make(chan bool, maxInFlight),
+		serial:   make(chan bool, 1),
+	}
+}
+
+// Run is the same as the package-level Run, but serialized by r.
+func (r *Runner) Run(ctx context.Context, commandstr string, wd ...In) error {
+	_, err := r.do(ctx, func(ctx context.Context) (string, error) {
+		return run(ctx, 0, true, commandstr, wd)
+	})
+	return err
+}
+
+// RunOutput is the same as the package-level RunOutput, but serialized by r.
+func (r *Runner) RunOutput(ctx context.Context, commandstr string, wd ...In) (string, error) {
+	return r.do(ctx, func(ctx context.Context) (string, error) {
+		return run(ctx, 0, true, commandstr, wd)
+	})
+}
+
+// Bash is the same as the package-level Bash, but serialized by r.
+func (r *Runner) Bash(ctx context.Context, script string, wd ...In) error {
+	_, err := r.do(ctx, func(ctx context.Context) (string, error) {
+		return bash(ctx, 0, true, script, wd)
+	})
+	return err
+}
+
+// Start is the same as the package-level Start, but serialized by r. Since
+// Start returns as soon as the process is spawned, it is subject to r's
+// concurrency limit but is not a candidate for the go.mod-race retry.
+func (r *Runner) Start(ctx context.Context, commandstr string, wd ...In) error {
+	select {
+	case r.inFlight <- true:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-r.inFlight }()
+	return StartContext(ctx, 0, commandstr, wd...)
+}
+
+// do runs invoke with at most maxInFlight concurrent slots. If invoke fails
+// with a recognized go.mod concurrency error, it is retried once on r's
+// single-slot serial channel, which other retries share but r.inFlight
+// invocations do not.
+func (r *Runner) do(ctx context.Context, invoke func(context.Context) (string, error)) (string, error) {
+	output, err := r.runSlot(ctx, r.inFlight, invoke)
+	if err != nil && isGoModRaceError(output, err) {
+		return r.runSlot(ctx, r.serial, invoke)
+	}
+	return output, err
+}
+
+func (r *Runner) runSlot(ctx context.Context, slot chan bool, invoke func(context.Context) (string, error)) (string, error) {
+	select {
+	case slot <- true:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-slot }()
+	return invoke(ctx)
+}
+
+func isGoModRaceError(output string, err error) bool {
+	return goModRaceError.MatchString(output) || goModRaceError.MatchString(err.Error())
+}
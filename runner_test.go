@@ -0,0 +1,102 @@
+package gosu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsGoModRaceError(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		err    error
+		want   bool
+	}{
+		{"matches in captured output", "go: go.mod contents have changed\n", errors.New("exit status 1"), true},
+		{"matches in the error text itself", "", errors.New("go: main module's go.mod contents have changed"), true},
+		{"unrelated error", "", errors.New("exit status 1"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isGoModRaceError(c.output, c.err); got != c.want {
+				t.Errorf("isGoModRaceError(%q, %v) = %v, want %v", c.output, c.err, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRunnerLimitsConcurrency(t *testing.T) {
+	r := NewRunner(2)
+
+	var inFlight, maxSeen int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.do(context.Background(), func(ctx context.Context) (string, error) {
+				n := atomic.AddInt32(&inFlight, 1)
+				for {
+					old := atomic.LoadInt32(&maxSeen)
+					if n <= old || atomic.CompareAndSwapInt32(&maxSeen, old, n) {
+						break
+					}
+				}
+				<-release
+				atomic.AddInt32(&inFlight, -1)
+				return "", nil
+			})
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&maxSeen); got > 2 {
+		t.Errorf("max concurrent invocations = %d, want <= 2", got)
+	}
+}
+
+func TestRunnerRetriesGoModRaceOnSerialSlot(t *testing.T) {
+	r := NewRunner(4)
+
+	var attempts int32
+	output, err := r.do(context.Background(), func(ctx context.Context) (string, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return "go: go.mod contents have changed", errors.New("exit status 1")
+		}
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	if output != "ok" {
+		t.Errorf("do() output = %q, want %q", output, "ok")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("attempts = %d, want 2 (one raced attempt, one serialized retry)", got)
+	}
+}
+
+func TestRunnerDoesNotRetryUnrelatedErrors(t *testing.T) {
+	r := NewRunner(4)
+
+	var attempts int32
+	_, err := r.do(context.Background(), func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&attempts, 1)
+		return "", errors.New("exit status 1")
+	})
+	if err == nil {
+		t.Fatal("do() error = nil, want the unrelated error to surface")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("attempts = %d, want 1 (no retry for a non-go.mod-race error)", got)
+	}
+}